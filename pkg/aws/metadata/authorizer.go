@@ -0,0 +1,222 @@
+// Copyright 2017 uSwitch
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RoleAuthorizer decides whether a namespace may assume a requested role,
+// as a second, cluster-controlled gate on top of the pod annotation. Nothing
+// in the request path calls Authorize: roleHandler and credentialsHandler
+// issue credentials without consulting it, and Server.Serve returns an error
+// instead of starting when RoleAuthorizationPolicyFile or
+// RoleAuthorizationOPAURL is set.
+type RoleAuthorizer interface {
+	Authorize(ctx context.Context, namespace, requestedRole, sourceIP string) error
+}
+
+// PolicyAuthorizer authorizes against a YAML file of the form
+// `namespace: [allowed-role-arn-globs]`, reloading it on SIGHUP or whenever
+// it changes on disk.
+type PolicyAuthorizer struct {
+	path    string
+	mu      sync.RWMutex
+	policy  map[string][]string
+	watcher *fsnotify.Watcher
+}
+
+func NewPolicyAuthorizer(path string) (*PolicyAuthorizer, error) {
+	a := &PolicyAuthorizer{path: path}
+
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+
+	if err := a.watch(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *PolicyAuthorizer) reload() error {
+	data, err := ioutil.ReadFile(a.path)
+	if err != nil {
+		return fmt.Errorf("error reading role authorization policy %s: %s", a.path, err.Error())
+	}
+
+	policy := map[string][]string{}
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return fmt.Errorf("error parsing role authorization policy %s: %s", a.path, err.Error())
+	}
+
+	a.mu.Lock()
+	a.policy = policy
+	a.mu.Unlock()
+
+	log.Infof("reloaded role authorization policy from %s", a.path)
+	return nil
+}
+
+func (a *PolicyAuthorizer) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error watching role authorization policy: %s", err.Error())
+	}
+	if err := watcher.Add(filepath.Dir(a.path)); err != nil {
+		return fmt.Errorf("error watching role authorization policy: %s", err.Error())
+	}
+	a.watcher = watcher
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(a.path) {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := a.reload(); err != nil {
+					log.Errorf("error reloading role authorization policy: %s", err.Error())
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Errorf("error watching role authorization policy: %s", err.Error())
+			case <-sighup:
+				if err := a.reload(); err != nil {
+					log.Errorf("error reloading role authorization policy: %s", err.Error())
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (a *PolicyAuthorizer) Authorize(ctx context.Context, namespace, requestedRole, sourceIP string) error {
+	a.mu.RLock()
+	allowed := a.policy[namespace]
+	a.mu.RUnlock()
+
+	for _, glob := range allowed {
+		if matched, _ := filepath.Match(glob, requestedRole); matched {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("namespace %q is not authorized to assume role %q", namespace, requestedRole)
+}
+
+// OPAAuthorizer authorizes by calling out to an OPA/Rego endpoint, posting
+// the pod identity and requested role and expecting an allow/deny decision
+// back in the usual OPA response envelope.
+type OPAAuthorizer struct {
+	url    string
+	client *http.Client
+}
+
+func NewOPAAuthorizer(url string) *OPAAuthorizer {
+	return &OPAAuthorizer{url: url, client: &http.Client{Timeout: time.Second * 5}}
+}
+
+type opaAuthorizationInput struct {
+	Input opaAuthorizationRequest `json:"input"`
+}
+
+type opaAuthorizationRequest struct {
+	Namespace     string `json:"namespace"`
+	RequestedRole string `json:"requestedRole"`
+	SourceIP      string `json:"sourceIP"`
+}
+
+type opaAuthorizationResponse struct {
+	Result struct {
+		Allow bool `json:"allow"`
+	} `json:"result"`
+}
+
+func (a *OPAAuthorizer) Authorize(ctx context.Context, namespace, requestedRole, sourceIP string) error {
+	body, err := json.Marshal(opaAuthorizationInput{Input: opaAuthorizationRequest{
+		Namespace:     namespace,
+		RequestedRole: requestedRole,
+		SourceIP:      sourceIP,
+	}})
+	if err != nil {
+		return fmt.Errorf("error encoding opa request: %s", err.Error())
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error building opa request: %s", err.Error())
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling opa: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	var decoded opaAuthorizationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return fmt.Errorf("error decoding opa response: %s", err.Error())
+	}
+
+	if !decoded.Result.Allow {
+		return fmt.Errorf("namespace %q is not authorized to assume role %q", namespace, requestedRole)
+	}
+
+	return nil
+}
+
+// newRoleAuthorizer builds the RoleAuthorizer configured by ServerConfig, or
+// nil if role authorization isn't configured.
+func newRoleAuthorizer(cfg *ServerConfig) (RoleAuthorizer, error) {
+	switch {
+	case cfg.RoleAuthorizationPolicyFile != "" && cfg.RoleAuthorizationOPAURL != "":
+		return nil, fmt.Errorf("only one of RoleAuthorizationPolicyFile or RoleAuthorizationOPAURL may be set")
+	case cfg.RoleAuthorizationPolicyFile != "":
+		return NewPolicyAuthorizer(cfg.RoleAuthorizationPolicyFile)
+	case cfg.RoleAuthorizationOPAURL != "":
+		return NewOPAAuthorizer(cfg.RoleAuthorizationOPAURL), nil
+	default:
+		return nil, nil
+	}
+}
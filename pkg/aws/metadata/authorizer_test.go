@@ -0,0 +1,81 @@
+// Copyright 2017 uSwitch
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePolicyFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "kiam-policy-test")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %s", err.Error())
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "policy.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("error writing policy file: %s", err.Error())
+	}
+
+	return path
+}
+
+func TestPolicyAuthorizerAllowsMatchingGlob(t *testing.T) {
+	path := writePolicyFile(t, "team-a:\n  - \"arn:aws:iam::111111111111:role/team-a-*\"\n")
+
+	authorizer, err := NewPolicyAuthorizer(path)
+	if err != nil {
+		t.Fatalf("error creating policy authorizer: %s", err.Error())
+	}
+
+	err = authorizer.Authorize(context.Background(), "team-a", "arn:aws:iam::111111111111:role/team-a-deploy", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("expected role matching allowed glob to be authorized, got: %s", err.Error())
+	}
+}
+
+func TestPolicyAuthorizerDeniesNonMatchingGlob(t *testing.T) {
+	path := writePolicyFile(t, "team-a:\n  - \"arn:aws:iam::111111111111:role/team-a-*\"\n")
+
+	authorizer, err := NewPolicyAuthorizer(path)
+	if err != nil {
+		t.Fatalf("error creating policy authorizer: %s", err.Error())
+	}
+
+	err = authorizer.Authorize(context.Background(), "team-a", "arn:aws:iam::111111111111:role/team-b-deploy", "10.0.0.1")
+	if err == nil {
+		t.Fatal("expected role not matching any allowed glob to be denied")
+	}
+}
+
+func TestPolicyAuthorizerDeniesUnknownNamespace(t *testing.T) {
+	path := writePolicyFile(t, "team-a:\n  - \"arn:aws:iam::111111111111:role/team-a-*\"\n")
+
+	authorizer, err := NewPolicyAuthorizer(path)
+	if err != nil {
+		t.Fatalf("error creating policy authorizer: %s", err.Error())
+	}
+
+	err = authorizer.Authorize(context.Background(), "team-b", "arn:aws:iam::111111111111:role/team-a-deploy", "10.0.0.1")
+	if err == nil {
+		t.Fatal("expected a namespace with no policy entry to be denied")
+	}
+}
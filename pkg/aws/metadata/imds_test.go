@@ -0,0 +1,81 @@
+// Copyright 2017 uSwitch
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIMDSv2TokenRoundTrip(t *testing.T) {
+	issuer := newIMDSv2TokenIssuer()
+
+	token := issuer.issue("10.0.0.1", time.Minute)
+
+	if err := issuer.verify(token, "10.0.0.1"); err != nil {
+		t.Fatalf("expected valid token to verify, got: %s", err.Error())
+	}
+}
+
+func TestIMDSv2TokenRejectsIPMismatch(t *testing.T) {
+	issuer := newIMDSv2TokenIssuer()
+
+	token := issuer.issue("10.0.0.1", time.Minute)
+
+	if err := issuer.verify(token, "10.0.0.2"); err == nil {
+		t.Fatal("expected token issued for a different client IP to be rejected")
+	}
+}
+
+func TestIMDSv2TokenRejectsExpiry(t *testing.T) {
+	issuer := newIMDSv2TokenIssuer()
+
+	token := issuer.issue("10.0.0.1", -time.Second)
+
+	if err := issuer.verify(token, "10.0.0.1"); err == nil {
+		t.Fatal("expected expired token to be rejected")
+	}
+}
+
+func TestIMDSv2TokenRejectsTamperedSignature(t *testing.T) {
+	issuer := newIMDSv2TokenIssuer()
+
+	token := issuer.issue("10.0.0.1", time.Minute)
+	tampered := token[:len(token)-1] + "X"
+
+	if err := issuer.verify(tampered, "10.0.0.1"); err == nil {
+		t.Fatal("expected token with a tampered signature to be rejected")
+	}
+}
+
+func TestIMDSv2TokenRejectsWrongKey(t *testing.T) {
+	issuer := newIMDSv2TokenIssuer()
+	other := newIMDSv2TokenIssuer()
+
+	token := issuer.issue("10.0.0.1", time.Minute)
+
+	if err := other.verify(token, "10.0.0.1"); err == nil {
+		t.Fatal("expected token signed by a different process key to be rejected")
+	}
+}
+
+func TestIMDSv2TokenRejectsMalformedToken(t *testing.T) {
+	issuer := newIMDSv2TokenIssuer()
+
+	for _, token := range []string{"", "not-a-token", "onlyonepart", "a.b.c"} {
+		if err := issuer.verify(token, "10.0.0.1"); err == nil {
+			t.Fatalf("expected malformed token %q to be rejected", token)
+		}
+	}
+}
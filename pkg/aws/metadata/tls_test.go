@@ -0,0 +1,58 @@
+// Copyright 2017 uSwitch
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metadata
+
+import "testing"
+
+func TestTLSConfigDisabledByDefault(t *testing.T) {
+	s := &Server{cfg: NewConfig(8181)}
+
+	cfg, err := s.tlsConfig()
+	if err != nil {
+		t.Fatalf("expected no error with no TLS fields set, got: %s", err.Error())
+	}
+	if cfg != nil {
+		t.Fatal("expected a nil tls.Config when TLS isn't configured")
+	}
+}
+
+func TestTLSConfigRejectsCertWithoutKey(t *testing.T) {
+	cfg := NewConfig(8181)
+	cfg.TLSCertFile = "/tmp/cert.pem"
+	s := &Server{cfg: cfg}
+
+	if _, err := s.tlsConfig(); err == nil {
+		t.Fatal("expected an error when TLSCertFile is set without TLSKeyFile")
+	}
+}
+
+func TestTLSConfigRejectsKeyWithoutCert(t *testing.T) {
+	cfg := NewConfig(8181)
+	cfg.TLSKeyFile = "/tmp/key.pem"
+	s := &Server{cfg: cfg}
+
+	if _, err := s.tlsConfig(); err == nil {
+		t.Fatal("expected an error when TLSKeyFile is set without TLSCertFile")
+	}
+}
+
+func TestTLSConfigRejectsClientCAWithoutCertAndKey(t *testing.T) {
+	cfg := NewConfig(8181)
+	cfg.ClientCAFile = "/tmp/ca.pem"
+	s := &Server{cfg: cfg}
+
+	if _, err := s.tlsConfig(); err == nil {
+		t.Fatal("expected an error when ClientCAFile is set without TLSCertFile/TLSKeyFile")
+	}
+}